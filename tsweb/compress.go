@@ -0,0 +1,329 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Encoder is a streaming compressor that Compress can reuse across
+// responses. *gzip.Writer, *zstd.Encoder and *brotli.Writer all
+// satisfy it.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// Encoding is a content coding that Compress can apply.
+type Encoding struct {
+	// Name is the content coding token sent in Content-Encoding, such
+	// as "gzip", "br" or "zstd".
+	Name string
+	// New returns a new Encoder. Encoders are pooled, and Reset is
+	// called before each use.
+	New func() Encoder
+}
+
+// GzipEncoding is the gzip Encoding, using the default compression
+// level.
+var GzipEncoding = Encoding{
+	Name: "gzip",
+	New:  func() Encoder { return gzip.NewWriter(nil) },
+}
+
+// defaultCompressibleTypes is the content type allow-list used when
+// CompressOptions.ContentTypes is nil.
+var defaultCompressibleTypes = []string{
+	"text/*",
+	"application/javascript",
+	"application/json",
+	"application/manifest+json",
+	"application/wasm",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// defaultCompressMinSize is the minimum body size used when
+// CompressOptions.MinSize is zero.
+const defaultCompressMinSize = 1024
+
+// CompressOptions configures the middleware returned by Compress.
+type CompressOptions struct {
+	// Encodings are the content codings to offer, in server
+	// preference order; the client's Accept-Encoding quality values
+	// take precedence. If nil, only GzipEncoding is used.
+	Encodings []Encoding
+
+	// ContentTypes is the allow-list of media types (without
+	// parameters) that are compressed. An entry "type/*" matches all
+	// subtypes. If nil, common text, script, JSON, SVG and wasm types
+	// are compressed.
+	ContentTypes []string
+
+	// MinSize is the smallest response body, in bytes, that is
+	// compressed; smaller responses are sent as-is. If zero, 1KiB is
+	// used. Use a negative value to compress all responses.
+	MinSize int
+}
+
+// Compress returns a handler that compresses responses from h on the
+// fly using the best encoding that both the client and opts support.
+//
+// Responses are left alone if they are smaller than opts.MinSize, have
+// a content type outside opts.ContentTypes, already have a
+// Content-Encoding, carry "Cache-Control: no-transform", or answer a
+// HEAD or Range request. Compressed responses have any ETag weakened,
+// so that conditional requests still match the wrapped handler's
+// validator, and no Accept-Ranges header.
+func Compress(h http.Handler, opts CompressOptions) http.Handler {
+	if opts.Encodings == nil {
+		opts.Encodings = []Encoding{GzipEncoding}
+	}
+	if opts.ContentTypes == nil {
+		opts.ContentTypes = defaultCompressibleTypes
+	}
+	if opts.MinSize == 0 {
+		opts.MinSize = defaultCompressMinSize
+	}
+	c := &compressor{
+		h:     h,
+		opts:  opts,
+		pools: make(map[string]*sync.Pool, len(opts.Encodings)),
+	}
+	for _, e := range opts.Encodings {
+		e := e
+		c.names = append(c.names, e.Name)
+		c.pools[e.Name] = &sync.Pool{New: func() any { return e.New() }}
+	}
+	return c
+}
+
+type compressor struct {
+	h     http.Handler
+	opts  CompressOptions
+	names []string              // opts.Encodings names, in order
+	pools map[string]*sync.Pool // of Encoder, keyed by encoding name
+}
+
+func (c *compressor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "HEAD" || r.Header.Get("Range") != "" {
+		c.h.ServeHTTP(w, r)
+		return
+	}
+	cw := &compressResponseWriter{ResponseWriter: w, c: c}
+	if encs := PreferredEncodings(r, c.names...); len(encs) > 0 {
+		cw.enc = encs[0]
+	}
+	defer cw.finish()
+	c.h.ServeHTTP(cw, r)
+}
+
+// compressible reports whether a response with content type ctype
+// should be compressed.
+func (c *compressor) compressible(ctype string) bool {
+	mt, _, _ := strings.Cut(ctype, ";")
+	mt = strings.ToLower(strings.TrimSpace(mt))
+	for _, allowed := range c.opts.ContentTypes {
+		if prefix := strings.TrimSuffix(allowed, "*"); prefix != allowed {
+			if strings.HasPrefix(mt, prefix) {
+				return true
+			}
+		} else if mt == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// compressResponseWriter buffers the start of a response until it
+// knows enough (status, headers and at least MinSize bytes of body) to
+// decide whether to compress it.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	c   *compressor
+	enc string // encoding to use if the response qualifies; "" if the client accepts none
+
+	code     int
+	buf      []byte
+	decided  bool
+	hijacked bool
+	ew       Encoder // non-nil once the response is being compressed
+}
+
+// WriteHeader implements http.ResponseWriter. The header is sent once
+// the compression decision is made.
+func (w *compressResponseWriter) WriteHeader(code int) {
+	if code < 200 {
+		// Informational responses precede the real one.
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.code != 0 || w.decided {
+		return
+	}
+	w.code = code
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		// No body is coming, so decide now.
+		w.decide()
+	}
+}
+
+// Write implements http.ResponseWriter.
+func (w *compressResponseWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if w.c.opts.MinSize < 0 || len(w.buf) >= w.c.opts.MinSize {
+			if err := w.decide(); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if w.ew != nil {
+		return w.ew.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide determines whether to compress the response, sends the
+// header, and flushes any buffered body.
+func (w *compressResponseWriter) decide() error {
+	w.decided = true
+	hdr := w.Header()
+	bodyAllowed := w.code != http.StatusNoContent && w.code != http.StatusNotModified
+	if bodyAllowed && hdr.Get("Content-Encoding") == "" && !strings.Contains(hdr.Get("Cache-Control"), "no-transform") {
+		ctype := hdr.Get("Content-Type")
+		if ctype == "" && len(w.buf) > 0 {
+			// Sniff now, as net/http would, so that the compressed
+			// bytes aren't sniffed instead.
+			ctype = http.DetectContentType(w.buf)
+			hdr.Set("Content-Type", ctype)
+		}
+		if w.c.compressible(ctype) {
+			if !varies(hdr, "Accept-Encoding") {
+				hdr.Add("Vary", "Accept-Encoding")
+			}
+			if w.enc != "" && (w.c.opts.MinSize < 0 || len(w.buf) >= w.c.opts.MinSize) {
+				hdr.Del("Content-Length")
+				hdr.Set("Content-Encoding", w.enc)
+				// The encoded body is not byte-for-byte the
+				// representation the wrapped handler tagged, so its
+				// validator is only weak, and byte ranges of it can't
+				// be served.
+				if etag, ok := weakETag(hdr.Get("ETag")); ok {
+					hdr.Set("ETag", etag)
+				} else {
+					hdr.Del("ETag")
+				}
+				hdr.Del("Accept-Ranges")
+				w.ew = w.c.pools[w.enc].Get().(Encoder)
+				w.ew.Reset(w.ResponseWriter)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.ew != nil {
+		_, err = w.ew.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// weakETag returns the weak form of etag. ok is false if etag is not a
+// well-formed entity tag.
+func weakETag(etag string) (_ string, ok bool) {
+	opaque := strings.TrimPrefix(etag, "W/")
+	if len(opaque) < 2 || opaque[0] != '"' || opaque[len(opaque)-1] != '"' {
+		return "", false
+	}
+	return "W/" + opaque, true
+}
+
+// varies reports whether hdr's Vary header already lists field, or
+// "*".
+func varies(hdr http.Header, field string) bool {
+	for _, v := range hdr.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "*" || strings.EqualFold(f, field) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// finish completes the response after the wrapped handler returns.
+func (w *compressResponseWriter) finish() {
+	if w.hijacked {
+		return
+	}
+	if !w.decided {
+		if w.code == 0 {
+			// The handler wrote nothing. Leave it to net/http.
+			return
+		}
+		w.decide()
+	}
+	if w.ew != nil {
+		w.ew.Close()
+		w.ew.Reset(nil)
+		w.c.pools[w.enc].Put(w.ew)
+		w.ew = nil
+	}
+}
+
+// Flush implements http.Flusher. It forces a compression decision
+// even if fewer than MinSize bytes have been written, since the handler
+// wants the client to see what it has so far.
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		w.decide()
+	}
+	if w.ew != nil {
+		w.ew.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, for handlers such as WebSocket
+// upgrades that take over the connection before writing a body.
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("ResponseWriter is not a Hijacker")
+	}
+	if w.decided {
+		return nil, nil, errors.New("response already started")
+	}
+	conn, buf, err := h.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, buf, err
+}
@@ -0,0 +1,373 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// upperEncoder is a toy Encoder that upper-cases its input, so tests
+// can tell which encoding was chosen without decoding.
+type upperEncoder struct{ w io.Writer }
+
+func (e *upperEncoder) Write(p []byte) (int, error) {
+	return e.w.Write([]byte(strings.ToUpper(string(p))))
+}
+func (e *upperEncoder) Flush() error      { return nil }
+func (e *upperEncoder) Close() error      { return nil }
+func (e *upperEncoder) Reset(w io.Writer) { e.w = w }
+
+var upperEncoding = Encoding{
+	Name: "x-upper",
+	New:  func() Encoder { return new(upperEncoder) },
+}
+
+func TestCompress(t *testing.T) {
+	big := strings.Repeat("hello, world. ", 200)
+	tests := []struct {
+		name     string
+		opts     CompressOptions
+		method   string
+		reqHdr   map[string]string
+		handler  http.HandlerFunc
+		wantEnc  string
+		wantVary bool
+		wantBody string
+		wantCode int
+	}{
+		{
+			name:   "gzip",
+			reqHdr: map[string]string{"Accept-Encoding": "gzip"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, big)
+			},
+			wantEnc:  "gzip",
+			wantVary: true,
+			wantBody: big,
+		},
+		{
+			name: "no_accept",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, big)
+			},
+			wantVary: true,
+			wantBody: big,
+		},
+		{
+			name:   "sniffed_type",
+			reqHdr: map[string]string{"Accept-Encoding": "gzip"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "<html>"+big)
+			},
+			wantEnc:  "gzip",
+			wantVary: true,
+			wantBody: "<html>" + big,
+		},
+		{
+			name:   "too_small",
+			reqHdr: map[string]string{"Accept-Encoding": "gzip"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, "tiny")
+			},
+			wantVary: true,
+			wantBody: "tiny",
+		},
+		{
+			name:   "min_size_negative",
+			opts:   CompressOptions{MinSize: -1},
+			reqHdr: map[string]string{"Accept-Encoding": "gzip"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, "tiny")
+			},
+			wantEnc:  "gzip",
+			wantVary: true,
+			wantBody: "tiny",
+		},
+		{
+			name:   "disallowed_type",
+			reqHdr: map[string]string{"Accept-Encoding": "gzip"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				io.WriteString(w, big)
+			},
+			wantBody: big,
+		},
+		{
+			name:   "already_encoded",
+			reqHdr: map[string]string{"Accept-Encoding": "gzip"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Encoding", "br")
+				io.WriteString(w, big)
+			},
+			wantEnc:  "br",
+			wantBody: big,
+		},
+		{
+			name:   "no_transform",
+			reqHdr: map[string]string{"Accept-Encoding": "gzip"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Cache-Control", "no-transform")
+				io.WriteString(w, big)
+			},
+			wantBody: big,
+		},
+		{
+			name:   "range",
+			reqHdr: map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=0-10"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, big)
+			},
+			wantBody: big,
+		},
+		{
+			name:   "not_modified",
+			reqHdr: map[string]string{"Accept-Encoding": "gzip"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusNotModified)
+			},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:   "status_preserved",
+			reqHdr: map[string]string{"Accept-Encoding": "gzip"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, big)
+			},
+			wantEnc:  "gzip",
+			wantVary: true,
+			wantBody: big,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:   "custom_encoding_preferred",
+			opts:   CompressOptions{Encodings: []Encoding{upperEncoding, GzipEncoding}},
+			reqHdr: map[string]string{"Accept-Encoding": "gzip, x-upper"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, big)
+			},
+			wantEnc:  "x-upper",
+			wantVary: true,
+			wantBody: strings.ToUpper(big),
+		},
+		{
+			name:   "client_q_wins",
+			opts:   CompressOptions{Encodings: []Encoding{upperEncoding, GzipEncoding}},
+			reqHdr: map[string]string{"Accept-Encoding": "gzip, x-upper;q=0.5"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, big)
+			},
+			wantEnc:  "gzip",
+			wantVary: true,
+			wantBody: big,
+		},
+		{
+			name:   "head",
+			method: "HEAD",
+			reqHdr: map[string]string{"Accept-Encoding": "gzip"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, big)
+			},
+			wantBody: big,
+		},
+		{
+			name:   "vary_already_set",
+			reqHdr: map[string]string{"Accept-Encoding": "gzip"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Vary", "accept-encoding")
+				io.WriteString(w, big)
+			},
+			wantEnc:  "gzip",
+			wantVary: true,
+			wantBody: big,
+		},
+		{
+			name:   "custom_types",
+			opts:   CompressOptions{ContentTypes: []string{"application/x-custom"}},
+			reqHdr: map[string]string{"Accept-Encoding": "gzip"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/x-custom; charset=utf-8")
+				io.WriteString(w, big)
+			},
+			wantEnc:  "gzip",
+			wantVary: true,
+			wantBody: big,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			for k, v := range tt.reqHdr {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			Compress(tt.handler, tt.opts).ServeHTTP(rec, req)
+			res := rec.Result()
+
+			wantCode := tt.wantCode
+			if wantCode == 0 {
+				wantCode = http.StatusOK
+			}
+			if res.StatusCode != wantCode {
+				t.Errorf("status = %d; want %d", res.StatusCode, wantCode)
+			}
+			if got := res.Header.Get("Content-Encoding"); got != tt.wantEnc {
+				t.Errorf("Content-Encoding = %q; want %q", got, tt.wantEnc)
+			}
+			vary := res.Header.Values("Vary")
+			if got := len(vary) == 1 && strings.EqualFold(vary[0], "Accept-Encoding"); got != tt.wantVary {
+				t.Errorf("Vary = %q; want Accept-Encoding: %v", vary, tt.wantVary)
+			}
+			var body io.Reader = res.Body
+			if tt.wantEnc == "gzip" {
+				zr, err := gzip.NewReader(res.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantBody {
+				t.Errorf("body = %q...; want %q...", trunc(string(got)), trunc(tt.wantBody))
+			}
+		})
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	h := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, strings.Repeat("a", 2000))
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "b")
+	}), CompressOptions{})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if !rec.Flushed {
+		t.Error("response was not flushed")
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("a", 2000) + "b"; string(got) != want {
+		t.Errorf("body = %q...; want %q...", trunc(string(got)), trunc(want))
+	}
+}
+
+func TestCompressStatic(t *testing.T) {
+	page := strings.Repeat("<p>hello, world.</p>\n", 100)
+	h := Compress(Static(fstest.MapFS{
+		"index.html": {Data: []byte(page)},
+	}, StaticOptions{}), CompressOptions{})
+	get := func(hdrs ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/index.html", nil)
+		for i := 0; i < len(hdrs); i += 2 {
+			req.Header.Set(hdrs[i], hdrs[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	plain := get()
+	if got := plain.Header().Get("Content-Encoding"); got != "" {
+		t.Fatalf("uncompressed Content-Encoding = %q; want none", got)
+	}
+	if got := plain.Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("uncompressed Accept-Ranges = %q; want bytes", got)
+	}
+
+	gz := get("Accept-Encoding", "gzip")
+	if got := gz.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q; want gzip", got)
+	}
+	plainTag, gzTag := plain.Header().Get("ETag"), gz.Header().Get("ETag")
+	if plainTag == "" || gzTag != "W/"+plainTag {
+		t.Errorf("ETags: uncompressed %q, gzip %q; want gzip to be the weak form", plainTag, gzTag)
+	}
+	if got := gz.Header().Get("Accept-Ranges"); got != "" {
+		t.Errorf("compressed Accept-Ranges = %q; want none", got)
+	}
+	if got := gz.Header().Values("Vary"); len(got) != 1 {
+		t.Errorf("Vary = %q; want a single Accept-Encoding", got)
+	}
+
+	// Revalidating with the ETag of either form succeeds.
+	for _, tag := range []string{plainTag, gzTag} {
+		if rec := get("Accept-Encoding", "gzip", "If-None-Match", tag); rec.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %s: code = %d; want %d", tag, rec.Code, http.StatusNotModified)
+		}
+	}
+
+	// A range request gets the unencoded bytes it asked for.
+	part := get("Accept-Encoding", "gzip", "Range", "bytes=0-9")
+	if part.Code != http.StatusPartialContent {
+		t.Fatalf("range request code = %d; want %d", part.Code, http.StatusPartialContent)
+	}
+	if got := part.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("range request Content-Encoding = %q; want none", got)
+	}
+	if got, want := part.Body.String(), page[:10]; got != want {
+		t.Errorf("range request body = %q; want %q", got, want)
+	}
+}
+
+func TestWeakETag(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+		ok       bool
+	}{
+		{`"abc"`, `W/"abc"`, true},
+		{`W/"abc"`, `W/"abc"`, true},
+		{`abc`, "", false},
+		{`W/`, "", false},
+		{`"`, "", false},
+	} {
+		got, ok := weakETag(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("weakETag(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func trunc(s string) string {
+	if len(s) > 20 {
+		return s[:20]
+	}
+	return s
+}
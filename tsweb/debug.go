@@ -14,6 +14,7 @@
 	"net/url"
 	"os"
 	"runtime"
+	"sync/atomic"
 
 	"tailscale.com/version"
 )
@@ -28,13 +29,22 @@
 //
 // Additionally, the Handle method offers a shorthand for correctly
 // registering debug handlers and cross-linking them from /debug/.
+//
+// Access to /debug/ and to handlers registered through the
+// DebugHandler is checked on every request with AllowDebugAccess, or
+// with the function passed to SetAuthorizer.
 type DebugHandler struct {
-	mux      *http.ServeMux                   // where this handler is registered
-	kvs      []func(io.Writer)                // output one <li>...</li> each, see KV()
-	urls     []string                         // one <li>...</li> block with link each
-	sections []func(io.Writer, *http.Request) // invoked in registration order prior to outputting </body>
+	mux       *http.ServeMux                   // where this handler is registered
+	kvs       []func(io.Writer)                // output one <li>...</li> each, see KV()
+	urls      []string                         // one <li>...</li> block with link each
+	sections  []func(io.Writer, *http.Request) // invoked in registration order prior to outputting </body>
+	authorize atomic.Value                     // of authorizer; see SetAuthorizer
 }
 
+// authorizer is the type stored in DebugHandler.authorize. A nil
+// authorizer means AllowDebugAccess is used.
+type authorizer func(*http.Request) bool
+
 // Debugger returns the DebugHandler registered on mux at /debug/,
 // creating it if necessary.
 func Debugger(mux *http.ServeMux) *DebugHandler {
@@ -50,7 +60,7 @@ func Debugger(mux *http.ServeMux) *DebugHandler {
 	// Register this one directly on mux, rather than using
 	// ret.URL/etc, as we don't need another line of output on the
 	// index page. The /pprof/ index already covers it.
-	mux.Handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	mux.Handle("/debug/pprof/profile", ret.protect(http.HandlerFunc(pprof.Profile)))
 
 	ret.KVFunc("Uptime", func() any { return Uptime() })
 	ret.KV("Version", version.Long)
@@ -69,7 +79,7 @@ func Debugger(mux *http.ServeMux) *DebugHandler {
 
 // ServeHTTP implements http.Handler.
 func (d *DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if !AllowDebugAccess(r) {
+	if !d.allowed(r) {
 		http.Error(w, "debug access denied", http.StatusForbidden)
 		return
 	}
@@ -96,10 +106,43 @@ func (d *DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // entry in /debug/ for it.
 func (d *DebugHandler) Handle(slug, desc string, handler http.Handler) {
 	href := "/debug/" + slug
-	d.mux.Handle(href, Protected(handler))
+	d.mux.Handle(href, d.protect(handler))
 	d.URL(href, desc)
 }
 
+// SetAuthorizer sets the function that decides whether r may access
+// /debug/ and the handlers registered through d, replacing the default
+// AllowDebugAccess check. It is consulted on every request, including
+// for handlers registered before SetAuthorizer was called. Passing nil
+// restores the default.
+//
+// An authorizer that wants to extend rather than replace the default
+// policy can call AllowDebugAccess itself.
+//
+// SetAuthorizer is safe to call while d is serving requests.
+func (d *DebugHandler) SetAuthorizer(f func(r *http.Request) bool) {
+	d.authorize.Store(authorizer(f))
+}
+
+// allowed reports whether r may access d's endpoints.
+func (d *DebugHandler) allowed(r *http.Request) bool {
+	if f, _ := d.authorize.Load().(authorizer); f != nil {
+		return f(r)
+	}
+	return AllowDebugAccess(r)
+}
+
+// protect wraps h to deny requests that d.allowed rejects.
+func (d *DebugHandler) protect(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !d.allowed(r) {
+			http.Error(w, "debug access denied", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 // KV adds a key/value list item to /debug/.
 func (d *DebugHandler) KV(k string, v any) {
 	val := html.EscapeString(fmt.Sprintf("%v", v))
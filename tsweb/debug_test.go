@@ -160,6 +160,37 @@ func TestDebuggerHandle(t *testing.T) {
 	}
 }
 
+func TestDebuggerSetAuthorizer(t *testing.T) {
+	mux := http.NewServeMux()
+	dbg := Debugger(mux)
+	dbg.Handle("check", "Consistency check", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+
+	allowPub := func(r *http.Request) bool {
+		return strings.HasPrefix(r.RemoteAddr, pubIP+":")
+	}
+	dbg.SetAuthorizer(allowPub)
+
+	for _, path := range []string{"/debug/", "/debug/check", "/debug/vars"} {
+		if code, _ := get(mux, path, pubIP); code != 200 {
+			t.Errorf("%s from authorized IP: got %v; want 200", path, code)
+		}
+		if code, _ := get(mux, path, tsIP); code != 403 {
+			t.Errorf("%s from unauthorized IP: got %v; want 403", path, code)
+		}
+	}
+
+	// Restoring the default applies to already-registered handlers.
+	dbg.SetAuthorizer(nil)
+	if code, _ := get(mux, "/debug/check", pubIP); code != 403 {
+		t.Errorf("/debug/check from public IP with default authorizer: got %v; want 403", code)
+	}
+	if code, _ := get(mux, "/debug/check", tsIP); code != 200 {
+		t.Errorf("/debug/check from Tailscale IP with default authorizer: got %v; want 200", code)
+	}
+}
+
 func ExampleDebugHandler_Handle() {
 	mux := http.NewServeMux()
 	dbg := Debugger(mux)
@@ -197,6 +228,17 @@ func ExampleDebugHandler_URL() {
 	dbg.URL("https://www.tailscale.com", "Homepage")
 }
 
+func ExampleDebugHandler_SetAuthorizer() {
+	mux := http.NewServeMux()
+	dbg := Debugger(mux)
+	// Additionally permits requests carrying a shared secret. A real
+	// deployment would compare against a configured token in constant
+	// time.
+	dbg.SetAuthorizer(func(r *http.Request) bool {
+		return AllowDebugAccess(r) || r.Header.Get("X-Debug-Token") == "hunter2"
+	})
+}
+
 func ExampleDebugHandler_Section() {
 	mux := http.NewServeMux()
 	dbg := Debugger(mux)
@@ -0,0 +1,140 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultEncodings are the content codings PreferredEncodings
+// considers when the caller doesn't name any, in server preference
+// order.
+var defaultEncodings = []string{"zstd", "br", "gzip"}
+
+// acceptedCoding is one parsed element of an Accept-Encoding header.
+type acceptedCoding struct {
+	name string  // lowercased coding name, or "*"
+	q    float64 // quality value in [0, 1]
+}
+
+// parseAcceptEncoding parses the Accept-Encoding header(s) in h.
+// Elements with malformed quality values are dropped, per RFC 9110
+// section 12.4.2. ok is false if no Accept-Encoding header is present.
+func parseAcceptEncoding(h http.Header) (codings []acceptedCoding, ok bool) {
+	vals := h.Values("Accept-Encoding")
+	if len(vals) == 0 {
+		return nil, false
+	}
+	for _, v := range vals {
+		for len(v) > 0 {
+			var part string
+			part, v, _ = strings.Cut(v, ",")
+			name, params, _ := strings.Cut(part, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			c := acceptedCoding{name: name, q: 1}
+			valid := true
+			for params != "" {
+				var param string
+				param, params, _ = strings.Cut(params, ";")
+				k, pv, _ := strings.Cut(param, "=")
+				if !strings.EqualFold(strings.TrimSpace(k), "q") {
+					continue
+				}
+				q, err := strconv.ParseFloat(strings.TrimSpace(pv), 64)
+				if err != nil || q < 0 {
+					valid = false
+					break
+				}
+				c.q = q
+			}
+			if valid {
+				codings = append(codings, c)
+			}
+		}
+	}
+	return codings, true
+}
+
+// encodingQuality returns the quality value the parsed codings assign
+// to enc, taking "*" and the implicit acceptability of "identity" into
+// account.
+func encodingQuality(codings []acceptedCoding, enc string) float64 {
+	wildcard := -1.0
+	for _, c := range codings {
+		switch c.name {
+		case enc:
+			return c.q
+		case "*":
+			wildcard = c.q
+		}
+	}
+	if wildcard >= 0 {
+		return wildcard
+	}
+	if enc == "identity" {
+		// identity is acceptable unless explicitly excluded.
+		return 1
+	}
+	return 0
+}
+
+// AcceptsEncoding reports whether r accepts the named encoding
+// ("gzip", "br", "zstd", etc).
+//
+// Quality values and the "*" wildcard are honored, so an encoding
+// listed with q=0 (or excluded via "*;q=0") is not accepted. The
+// "identity" encoding is accepted unless explicitly excluded.
+func AcceptsEncoding(r *http.Request, enc string) bool {
+	enc = strings.ToLower(enc)
+	codings, ok := parseAcceptEncoding(r.Header)
+	if !ok {
+		return enc == "identity"
+	}
+	return encodingQuality(codings, enc) > 0
+}
+
+// PreferredEncodings returns the subset of supported encodings that r
+// accepts, ordered by the client's preference (highest quality value
+// first). Encodings the client rates equally keep their relative order
+// in supported, so callers should list them in their own order of
+// preference.
+//
+// If supported is empty, the zstd, br and gzip encodings are
+// considered, in that order. A nil result means the response should
+// not be encoded.
+func PreferredEncodings(r *http.Request, supported ...string) []string {
+	codings, ok := parseAcceptEncoding(r.Header)
+	if !ok {
+		return nil
+	}
+	if len(supported) == 0 {
+		supported = defaultEncodings
+	}
+	type candidate struct {
+		enc string
+		q   float64
+	}
+	var cands []candidate
+	for _, enc := range supported {
+		if q := encodingQuality(codings, strings.ToLower(enc)); q > 0 {
+			cands = append(cands, candidate{enc, q})
+		}
+	}
+	if len(cands) == 0 {
+		return nil
+	}
+	sort.SliceStable(cands, func(i, j int) bool { return cands[i].q > cands[j].q })
+	ret := make([]string, 0, len(cands))
+	for _, c := range cands {
+		ret = append(ret, c.enc)
+	}
+	return ret
+}
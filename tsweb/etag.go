@@ -0,0 +1,141 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultHashedName matches file names that embed a content hash in
+// the style produced by esbuild's default "[name]-[hash]" naming
+// ("main-2KFQ3QAB.js"): a dash, eight characters of the base32
+// alphabet A-Z and 2-7, then the extension. The first submatch is the
+// hash.
+//
+// The pattern cannot tell a hash from an ordinary upper-case word, so
+// it also matches names like "notes-DOWNLOAD.md". Matching files are
+// cached as immutable by Static, so use it only for directories that
+// contain nothing but bundler output.
+var DefaultHashedName = regexp.MustCompile(`-([A-Z2-7]{8})\.[^./]+$`)
+
+// ETagger derives strong ETags for the files of an fs.FS. Files whose
+// names embed a content hash get an ETag made from that hash without
+// being read; other files are hashed once and the result is cached,
+// so the FS must not change underneath the ETagger.
+//
+// An ETagger is safe for concurrent use.
+type ETagger struct {
+	fsys       fs.FS
+	hashedName *regexp.Regexp
+
+	mu    sync.Mutex
+	cache map[string]string // file name => quoted ETag
+}
+
+// NewETagger returns an ETagger for fsys. If hashedName is non-nil,
+// file names it matches use its first submatch as their content hash;
+// DefaultHashedName suits esbuild output. If hashedName is nil,
+// every file's ETag is computed from its contents.
+func NewETagger(fsys fs.FS, hashedName *regexp.Regexp) *ETagger {
+	return &ETagger{
+		fsys:       fsys,
+		hashedName: hashedName,
+		cache:      make(map[string]string),
+	}
+}
+
+// ETag returns the quoted strong ETag for the named file when served
+// in content coding enc ("" for no coding). Different codings of the
+// same file get different ETags, as their bytes differ; when computed
+// from content, the bytes hashed are those of the file's precompressed
+// sibling, as found by Precompressed.
+func (e *ETagger) ETag(name, enc string) (string, error) {
+	if e.hashedName != nil {
+		if m := e.hashedName.FindStringSubmatch(name); len(m) > 1 && m[1] != "" {
+			if enc != "" {
+				return `"` + m[1] + "-" + enc + `"`, nil
+			}
+			return `"` + m[1] + `"`, nil
+		}
+	}
+	if enc != "" {
+		name += encodingSuffix(enc)
+	}
+	e.mu.Lock()
+	etag, ok := e.cache[name]
+	e.mu.Unlock()
+	if ok {
+		return etag, nil
+	}
+	f, err := e.fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	etag = `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	e.mu.Lock()
+	e.cache[name] = etag
+	e.mu.Unlock()
+	return etag, nil
+}
+
+// CheckETag sets the ETag header on w to etag (which must be quoted)
+// and evaluates r's If-Match and If-None-Match preconditions against
+// it, per RFC 9110 section 13. If a precondition means the response is
+// complete, CheckETag writes a 304 (Not Modified) or 412 (Precondition
+// Failed) response and returns true; the caller should then write
+// nothing further.
+//
+// Handlers using http.ServeContent don't need CheckETag; setting the
+// ETag header before calling it is enough.
+func CheckETag(w http.ResponseWriter, r *http.Request, etag string) (done bool) {
+	w.Header().Set("ETag", etag)
+	if im := r.Header.Get("If-Match"); im != "" && !etagListMatches(im, etag, true) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return true
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListMatches(inm, etag, false) {
+		if r.Method == "GET" || r.Method == "HEAD" {
+			w.WriteHeader(http.StatusNotModified)
+		} else {
+			w.WriteHeader(http.StatusPreconditionFailed)
+		}
+		return true
+	}
+	return false
+}
+
+// etagListMatches reports whether the comma-separated entity-tag list
+// (or "*") in header matches etag. Strong comparison requires both tags
+// to be strong; weak comparison ignores the W/ prefix.
+func etagListMatches(header, etag string, strong bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etagWeak := strings.HasPrefix(etag, "W/")
+	opaque := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		weak := strings.HasPrefix(candidate, "W/")
+		if strong && (weak || etagWeak) {
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == opaque {
+			return true
+		}
+	}
+	return false
+}
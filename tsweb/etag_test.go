@@ -0,0 +1,181 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDefaultHashedName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"main-2KFQ3QAB.js", "2KFQ3QAB"},
+		{"dir/index-ABCD2345.css", "ABCD2345"},
+		{"chunk-ABCDEFG7.js", "ABCDEFG7"},
+		{"chunk-ABCDEFGH.js", "ABCDEFGH"},
+		{"notes-DOWNLOAD.md", "DOWNLOAD"}, // documented false positive
+		{"main.js", ""},
+		{"my-component.js", ""},
+		{"main-2kfq3qab.js", ""},
+		{"main-2KFQ3QA.js", ""},
+		{"main-2KFQ3QABC.js", ""},
+		{"main-2KFQ3QAB", ""},
+		{"main.2KFQ3QAB.js", ""},
+		{"main.3b1f8c2e9d7a4f60.js", ""},
+		{"main-2KFQ3QA0.js", ""},
+		{"main-2KFQ3QA8.js", ""},
+		{"LICENSE-APACHE20.txt", ""},
+	}
+	for _, tt := range tests {
+		var got string
+		if m := DefaultHashedName.FindStringSubmatch(tt.name); m != nil {
+			got = m[1]
+		}
+		if got != tt.want {
+			t.Errorf("DefaultHashedName(%q) = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestETagger(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main-2KFQ3QAB.js": {Data: []byte("hashed")},
+		"index.html":       {Data: []byte("<html>")},
+		"index.html.gz":    {Data: []byte("gzipped")},
+		"other.html":       {Data: []byte("<html>")},
+	}
+	et := NewETagger(fsys, DefaultHashedName)
+
+	mustETag := func(name, enc string) string {
+		t.Helper()
+		etag, err := et.ETag(name, enc)
+		if err != nil {
+			t.Fatalf("ETag(%q, %q): %v", name, enc, err)
+		}
+		return etag
+	}
+
+	if got, want := mustETag("main-2KFQ3QAB.js", ""), `"2KFQ3QAB"`; got != want {
+		t.Errorf("hashed name ETag = %s; want %s", got, want)
+	}
+	if got, want := mustETag("main-2KFQ3QAB.js", "br"), `"2KFQ3QAB-br"`; got != want {
+		t.Errorf("hashed name br ETag = %s; want %s", got, want)
+	}
+
+	plain := mustETag("index.html", "")
+	if plain == "" || plain[0] != '"' || plain[len(plain)-1] != '"' {
+		t.Errorf("computed ETag %s is not a quoted strong ETag", plain)
+	}
+	if gz := mustETag("index.html", "gzip"); gz == plain {
+		t.Errorf("gzip and identity ETags are both %s", gz)
+	}
+	if other := mustETag("other.html", ""); other != plain {
+		t.Errorf("identical content got different ETags %s and %s", plain, other)
+	}
+
+	// Computed ETags are cached, so later changes to the FS aren't seen.
+	fsys["index.html"].Data = []byte("changed")
+	if got := mustETag("index.html", ""); got != plain {
+		t.Errorf("cached ETag changed from %s to %s", plain, got)
+	}
+
+	if _, err := et.ETag("missing.html", ""); err == nil {
+		t.Error("ETag of missing file succeeded")
+	}
+
+	// Without a pattern, hashed names are computed too.
+	got, err := NewETagger(fsys, nil).ETag("main-2KFQ3QAB.js", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == `"2KFQ3QAB"` {
+		t.Errorf("nil pattern still derived ETag from name")
+	}
+}
+
+func TestCheckETag(t *testing.T) {
+	const etag = `"abc"`
+	tests := []struct {
+		name     string
+		method   string
+		hdr      map[string]string
+		wantDone bool
+		wantCode int
+	}{
+		{name: "no_conditions", wantDone: false},
+		{name: "inm_match", hdr: map[string]string{"If-None-Match": `"abc"`}, wantDone: true, wantCode: 304},
+		{name: "inm_weak_match", hdr: map[string]string{"If-None-Match": `W/"abc"`}, wantDone: true, wantCode: 304},
+		{name: "inm_list", hdr: map[string]string{"If-None-Match": `"x", "abc"`}, wantDone: true, wantCode: 304},
+		{name: "inm_star", hdr: map[string]string{"If-None-Match": `*`}, wantDone: true, wantCode: 304},
+		{name: "inm_mismatch", hdr: map[string]string{"If-None-Match": `"x"`}, wantDone: false},
+		{name: "inm_match_put", method: "PUT", hdr: map[string]string{"If-None-Match": `"abc"`}, wantDone: true, wantCode: 412},
+		{name: "im_match", hdr: map[string]string{"If-Match": `"abc"`}, wantDone: false},
+		{name: "im_star", hdr: map[string]string{"If-Match": `*`}, wantDone: false},
+		{name: "im_mismatch", hdr: map[string]string{"If-Match": `"x"`}, wantDone: true, wantCode: 412},
+		{name: "im_weak", hdr: map[string]string{"If-Match": `W/"abc"`}, wantDone: true, wantCode: 412},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			for k, v := range tt.hdr {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			done := CheckETag(rec, req, etag)
+			if done != tt.wantDone {
+				t.Errorf("done = %v; want %v", done, tt.wantDone)
+			}
+			if done && rec.Code != tt.wantCode {
+				t.Errorf("code = %d; want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %q; want %q", got, etag)
+			}
+		})
+	}
+}
+
+func TestPrecompressedETags(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main-2KFQ3QAB.js":    {Data: []byte("plain")},
+		"main-2KFQ3QAB.js.gz": {Data: []byte("gzip")},
+	}
+	h := Precompressed(fsys, PrecompressedOptions{ETags: NewETagger(fsys, DefaultHashedName)})
+
+	get := func(accept, inm string) *http.Response {
+		req := httptest.NewRequest("GET", "/main-2KFQ3QAB.js", nil)
+		if accept != "" {
+			req.Header.Set("Accept-Encoding", accept)
+		}
+		if inm != "" {
+			req.Header.Set("If-None-Match", inm)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	if got, want := get("", "").Header.Get("ETag"), `"2KFQ3QAB"`; got != want {
+		t.Errorf("identity ETag = %q; want %q", got, want)
+	}
+	if got, want := get("gzip", "").Header.Get("ETag"), `"2KFQ3QAB-gzip"`; got != want {
+		t.Errorf("gzip ETag = %q; want %q", got, want)
+	}
+	if got := get("gzip", `"2KFQ3QAB-gzip"`).StatusCode; got != http.StatusNotModified {
+		t.Errorf("matching If-None-Match: status %d; want 304", got)
+	}
+	if got := get("", `"2KFQ3QAB-gzip"`).StatusCode; got != http.StatusOK {
+		t.Errorf("If-None-Match for other encoding: status %d; want 200", got)
+	}
+}
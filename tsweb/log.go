@@ -46,6 +46,10 @@ type AccessLogRecord struct {
 	Bytes int `json:"bytes"`
 	// Error encountered during request processing.
 	Err string `json:"err"`
+
+	// The upper bound of the latency bucket the request fell into,
+	// when logged by LogRequests with LatencyBuckets configured.
+	LatencyBucket string `json:"latency_bucket,omitempty"`
 }
 
 // String returns m as a JSON string.
@@ -0,0 +1,168 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// PrecompressedOptions configures the handler returned by
+// Precompressed.
+type PrecompressedOptions struct {
+	// Encodings lists the content codings for which precompressed
+	// siblings are looked up, in server preference order. A file
+	// "foo.js" has siblings "foo.js.zst", "foo.js.br" and
+	// "foo.js.gz" for "zstd", "br" and "gzip" respectively; other
+	// codings use their name as the suffix. If nil, zstd, br and gzip
+	// are used.
+	Encodings []string
+
+	// CacheControl, if non-nil, returns the Cache-Control header to
+	// send for the named file (the path within the FS, without any
+	// compression suffix). An empty return value sends no header.
+	CacheControl func(name string) string
+
+	// ModTime, if non-zero, is reported as the modification time of
+	// every file, for Last-Modified and If-Modified-Since handling.
+	// This is useful with embed.FS, whose files have no modification
+	// time; the process start time is a reasonable choice. If zero,
+	// each file's own modification time is used.
+	ModTime time.Time
+
+	// ETags, if non-nil, provides a strong ETag for each response,
+	// enabling If-None-Match and If-Match handling. It should be an
+	// ETagger for the same FS.
+	ETags *ETagger
+}
+
+// encodingSuffix returns the file name suffix used for precompressed
+// siblings in the given content coding.
+func encodingSuffix(enc string) string {
+	switch enc {
+	case "gzip":
+		return ".gz"
+	case "zstd":
+		return ".zst"
+	}
+	return "." + enc
+}
+
+// Precompressed returns an http.Handler that serves files from fsys,
+// using the request path relative to the root of fsys (use
+// http.StripPrefix to mount it elsewhere).
+//
+// If the client accepts one of opts.Encodings and fsys contains the
+// corresponding precompressed sibling of the requested file, the
+// sibling is served with the appropriate Content-Encoding. Otherwise
+// the file itself is served. Directories are not listed.
+func Precompressed(fsys fs.FS, opts PrecompressedOptions) http.Handler {
+	if opts.Encodings == nil {
+		opts.Encodings = defaultEncodings
+	}
+	return precompressedHandler{fsys, opts}
+}
+
+type precompressedHandler struct {
+	fsys fs.FS
+	opts PrecompressedOptions
+}
+
+func (h precompressedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" || !fs.ValidPath(name) {
+		http.NotFound(w, r)
+		return
+	}
+	f, enc, err := h.open(r, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		// fs.File does not promise Seek, but http.ServeContent needs
+		// it for range and size handling.
+		b, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+
+	hdr := w.Header()
+	if len(h.opts.Encodings) > 0 {
+		hdr.Add("Vary", "Accept-Encoding")
+	}
+	if enc != "" {
+		hdr.Set("Content-Encoding", enc)
+		// Don't let ServeContent sniff the compressed bytes.
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		hdr.Set("Content-Type", ctype)
+	}
+	if h.opts.CacheControl != nil {
+		if cc := h.opts.CacheControl(name); cc != "" {
+			hdr.Set("Cache-Control", cc)
+		}
+	}
+	if h.opts.ETags != nil {
+		etag, err := h.opts.ETags.ETag(name, enc)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		hdr.Set("ETag", etag)
+	}
+	modTime := h.opts.ModTime
+	if modTime.IsZero() {
+		modTime = fi.ModTime()
+	}
+	http.ServeContent(w, r, name, modTime, content)
+}
+
+// open opens the best representation of name in h.fsys that r
+// accepts, returning the file and the content coding it is in ("" for
+// the plain file).
+func (h precompressedHandler) open(r *http.Request, name string) (_ fs.File, enc string, _ error) {
+	if len(h.opts.Encodings) > 0 {
+		for _, enc := range PreferredEncodings(r, h.opts.Encodings...) {
+			if f, err := h.fsys.Open(name + encodingSuffix(enc)); err == nil {
+				return f, enc, nil
+			}
+		}
+	}
+	f, err := h.fsys.Open(name)
+	return f, "", err
+}
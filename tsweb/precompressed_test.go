@@ -0,0 +1,124 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestPrecompressed(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":          {Data: []byte("plain js")},
+		"app.js.gz":       {Data: []byte("gzip js")},
+		"app.js.br":       {Data: []byte("brotli js")},
+		"app.js.zst":      {Data: []byte("zstd js")},
+		"style.css":       {Data: []byte("plain css")},
+		"style.css.gz":    {Data: []byte("gzip css")},
+		"blob.unknown":    {Data: []byte("plain blob")},
+		"blob.unknown.gz": {Data: []byte("gzip blob")},
+		"dir/index.html":  {Data: []byte("<html>")},
+	}
+	modTime := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	h := Precompressed(fsys, PrecompressedOptions{
+		CacheControl: func(name string) string {
+			if strings.HasSuffix(name, ".js") {
+				return "public, max-age=60"
+			}
+			return ""
+		},
+		ModTime: modTime,
+	})
+
+	jsType := mime.TypeByExtension(".js")
+	cssType := mime.TypeByExtension(".css")
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		accept    string
+		wantCode  int
+		wantBody  string
+		wantEnc   string
+		wantType  string
+		wantCache string
+	}{
+		{name: "plain", path: "/app.js", wantCode: 200, wantBody: "plain js", wantType: jsType, wantCache: "public, max-age=60"},
+		{name: "gzip", path: "/app.js", accept: "gzip", wantCode: 200, wantBody: "gzip js", wantEnc: "gzip", wantType: jsType, wantCache: "public, max-age=60"},
+		{name: "br_over_gzip", path: "/app.js", accept: "gzip, br", wantCode: 200, wantBody: "brotli js", wantEnc: "br", wantType: jsType, wantCache: "public, max-age=60"},
+		{name: "zstd_preferred", path: "/app.js", accept: "gzip, br, zstd", wantCode: 200, wantBody: "zstd js", wantEnc: "zstd", wantType: jsType, wantCache: "public, max-age=60"},
+		{name: "client_q", path: "/app.js", accept: "gzip, br;q=0.5", wantCode: 200, wantBody: "gzip js", wantEnc: "gzip", wantType: jsType, wantCache: "public, max-age=60"},
+		{name: "missing_sibling", path: "/style.css", accept: "br", wantCode: 200, wantBody: "plain css", wantType: cssType},
+		{name: "fallback_sibling", path: "/style.css", accept: "br, gzip", wantCode: 200, wantBody: "gzip css", wantEnc: "gzip", wantType: cssType},
+		{name: "unknown_type", path: "/blob.unknown", accept: "gzip", wantCode: 200, wantBody: "gzip blob", wantEnc: "gzip", wantType: "application/octet-stream"},
+		{name: "not_found", path: "/nope.js", accept: "gzip", wantCode: 404},
+		{name: "dir", path: "/dir", wantCode: 404},
+		{name: "root", path: "/", wantCode: 404},
+		{name: "dotdot", path: "/../app.js", wantCode: 200, wantBody: "plain js", wantType: jsType, wantCache: "public, max-age=60"},
+		{name: "post", method: "POST", path: "/app.js", wantCode: 405},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			res := rec.Result()
+			if res.StatusCode != tt.wantCode {
+				t.Fatalf("status = %d; want %d", res.StatusCode, tt.wantCode)
+			}
+			if tt.wantCode != 200 {
+				return
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q; want %q", got, tt.wantBody)
+			}
+			if got := res.Header.Get("Content-Encoding"); got != tt.wantEnc {
+				t.Errorf("Content-Encoding = %q; want %q", got, tt.wantEnc)
+			}
+			if got := res.Header.Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q; want %q", got, tt.wantType)
+			}
+			if got := res.Header.Get("Cache-Control"); got != tt.wantCache {
+				t.Errorf("Cache-Control = %q; want %q", got, tt.wantCache)
+			}
+			if got, want := res.Header.Get("Vary"), "Accept-Encoding"; got != want {
+				t.Errorf("Vary = %q; want %q", got, want)
+			}
+			if got, want := res.Header.Get("Last-Modified"), modTime.Format(http.TimeFormat); got != want {
+				t.Errorf("Last-Modified = %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPrecompressedNoEncodings(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":    {Data: []byte("plain js")},
+		"app.js.gz": {Data: []byte("gzip js")},
+	}
+	h := Precompressed(fsys, PrecompressedOptions{Encodings: []string{}})
+	req := httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got, want := rec.Body.String(), "plain js"; got != want {
+		t.Errorf("body = %q; want %q", got, want)
+	}
+	if got := rec.Result().Header.Get("Vary"); got != "" {
+		t.Errorf("Vary = %q; want none", got)
+	}
+}
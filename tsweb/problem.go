@@ -0,0 +1,77 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// RequestIDHeader is the request header whose value, if present, is
+// reported as the RequestID of problems written by
+// ProblemErrorHandler.
+const RequestIDHeader = "X-Request-Id"
+
+// Problem is an RFC 7807 problem details object, for returning errors
+// that programmatic clients can parse.
+type Problem struct {
+	// Type is a URI identifying the problem type. If empty, clients
+	// treat it as "about:blank", meaning the problem is described by
+	// the status code alone.
+	Type string `json:"type,omitempty"`
+	// Title is a short, human-readable summary of the problem type.
+	// If empty, WriteProblem uses the status text.
+	Title string `json:"title,omitempty"`
+	// Status is the HTTP status code. If zero, WriteProblem uses 500.
+	Status int `json:"status,omitempty"`
+	// Detail is a human-readable explanation of this occurrence of
+	// the problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance is a URI identifying this occurrence of the problem.
+	Instance string `json:"instance,omitempty"`
+
+	// Code is a machine-readable error code, stable across releases,
+	// for clients that need to distinguish problems of the same type.
+	Code string `json:"code,omitempty"`
+	// RequestID identifies the request, for correlation with server
+	// logs.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// WriteProblem writes p to w as an application/problem+json response
+// with status p.Status.
+func WriteProblem(w http.ResponseWriter, p Problem) {
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	h := w.Header()
+	h.Set("Content-Type", ProblemContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// ProblemErrorHandler is an ErrorHandlerFunc, for use as
+// HandlerOptions.OnError, that sends HTTPErrors as problem details. The
+// HTTPError's Msg becomes the Detail; its Err is not sent to the
+// client.
+func ProblemErrorHandler(w http.ResponseWriter, r *http.Request, e HTTPError) {
+	code := e.Code
+	if code == 0 {
+		code = http.StatusInternalServerError
+	}
+	WriteProblem(w, Problem{
+		Status:    code,
+		Detail:    e.Msg,
+		Instance:  r.URL.Path,
+		RequestID: r.Header.Get(RequestIDHeader),
+	})
+}
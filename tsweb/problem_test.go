@@ -0,0 +1,137 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteProblem(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       Problem
+		wantCode int
+		want     Problem
+	}{
+		{
+			name:     "defaults",
+			in:       Problem{Detail: "boom"},
+			wantCode: 500,
+			want:     Problem{Title: "Internal Server Error", Status: 500, Detail: "boom"},
+		},
+		{
+			name: "full",
+			in: Problem{
+				Type:      "https://tailscale.com/problems/bad-key",
+				Title:     "Bad key",
+				Status:    400,
+				Detail:    "key is malformed",
+				Instance:  "/api/key",
+				Code:      "bad_key",
+				RequestID: "abc123",
+			},
+			wantCode: 400,
+			want: Problem{
+				Type:      "https://tailscale.com/problems/bad-key",
+				Title:     "Bad key",
+				Status:    400,
+				Detail:    "key is malformed",
+				Instance:  "/api/key",
+				Code:      "bad_key",
+				RequestID: "abc123",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			WriteProblem(rec, tt.in)
+			if rec.Code != tt.wantCode {
+				t.Errorf("code = %d; want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("Content-Type"); got != ProblemContentType {
+				t.Errorf("Content-Type = %q; want %q", got, ProblemContentType)
+			}
+			var got Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("wrong problem (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestProblemErrorHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+		want     Problem
+	}{
+		{
+			name:     "http_error",
+			err:      Error(http.StatusNotFound, "no such peer", errors.New("secret internal detail")),
+			wantCode: http.StatusNotFound,
+			want: Problem{
+				Title:     "Not Found",
+				Status:    404,
+				Detail:    "no such peer",
+				Instance:  "/peers/foo",
+				RequestID: "req-1",
+			},
+		},
+		{
+			name:     "plain_error",
+			err:      errors.New("secret internal detail"),
+			wantCode: http.StatusInternalServerError,
+			want: Problem{
+				Title:     "Internal Server Error",
+				Status:    500,
+				Detail:    "internal server error",
+				Instance:  "/peers/foo",
+				RequestID: "req-1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rh := ReturnHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				return tt.err
+			})
+			h := StdHandler(rh, HandlerOptions{OnError: ProblemErrorHandler})
+
+			req := httptest.NewRequest("GET", "/peers/foo", nil)
+			req.Header.Set(RequestIDHeader, "req-1")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("code = %d; want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("Content-Type"); got != ProblemContentType {
+				t.Errorf("Content-Type = %q; want %q", got, ProblemContentType)
+			}
+			if strings.Contains(rec.Body.String(), "secret") {
+				t.Errorf("response leaks internal error: %q", rec.Body.String())
+			}
+			var got Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("wrong problem (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
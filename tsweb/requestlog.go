@@ -0,0 +1,138 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"tailscale.com/types/logger"
+)
+
+// RequestLogOptions configures the middleware returned by LogRequests.
+type RequestLogOptions struct {
+	// Logf is where request records are logged, as an
+	// AccessLogRecord passed to a "%s" format. If nil, records are
+	// discarded.
+	Logf logger.Logf
+
+	// SampleRates maps URL path prefixes to the fraction, in [0, 1],
+	// of successful requests under that prefix to log. The longest
+	// matching prefix applies. Requests matching no prefix are always
+	// logged. Responses with a status of 400 or above are always
+	// logged regardless of sampling.
+	SampleRates map[string]float64
+
+	// LatencyBuckets, if non-empty, are ascending upper bounds used
+	// to classify request latency. Each record's LatencyBucket is set
+	// to the smallest bound the request completed within, or to
+	// "+Inf" if it took longer than all of them.
+	LatencyBuckets []time.Duration
+
+	// Redact, if non-nil, is called with each record before it is
+	// logged and may modify it, e.g. to strip secrets from the
+	// RequestURI or drop the RemoteAddr.
+	Redact func(*AccessLogRecord)
+
+	Now func() time.Time // if nil, defaults to time.Now
+}
+
+// LogRequests returns a handler that calls h and logs an
+// AccessLogRecord for a sample of the requests it serves, as
+// configured by opts.
+//
+// Unlike StdHandler, LogRequests wraps an ordinary http.Handler and
+// doesn't alter responses; it only observes them.
+func LogRequests(h http.Handler, opts RequestLogOptions) http.Handler {
+	if opts.Logf == nil {
+		opts.Logf = logger.Discard
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	rl := &requestLogger{h: h, opts: opts, randFloat64: rand.Float64}
+	for p := range opts.SampleRates {
+		rl.prefixes = append(rl.prefixes, p)
+	}
+	// Longest first, so the first match is the most specific.
+	sort.Slice(rl.prefixes, func(i, j int) bool { return len(rl.prefixes[i]) > len(rl.prefixes[j]) })
+	return rl
+}
+
+type requestLogger struct {
+	h        http.Handler
+	opts     RequestLogOptions
+	prefixes []string // keys of opts.SampleRates, longest first
+
+	randFloat64 func() float64 // rand.Float64, or a stub in tests
+}
+
+// sampleRate returns the fraction of successful requests for path
+// that should be logged.
+func (rl *requestLogger) sampleRate(path string) float64 {
+	for _, p := range rl.prefixes {
+		if strings.HasPrefix(path, p) {
+			return rl.opts.SampleRates[p]
+		}
+	}
+	return 1
+}
+
+// latencyBucket returns the label of the latency bucket d falls into,
+// or "" if no buckets are configured.
+func (rl *requestLogger) latencyBucket(d time.Duration) string {
+	if len(rl.opts.LatencyBuckets) == 0 {
+		return ""
+	}
+	for _, b := range rl.opts.LatencyBuckets {
+		if d <= b {
+			return b.String()
+		}
+	}
+	return "+Inf"
+}
+
+func (rl *requestLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	msg := AccessLogRecord{
+		When:       rl.opts.Now(),
+		RemoteAddr: r.RemoteAddr,
+		Proto:      r.Proto,
+		TLS:        r.TLS != nil,
+		Host:       r.Host,
+		Method:     r.Method,
+		RequestURI: r.URL.RequestURI(),
+		UserAgent:  r.UserAgent(),
+		Referer:    r.Referer(),
+	}
+
+	lw := &loggingResponseWriter{ResponseWriter: w, logf: rl.opts.Logf}
+	rl.h.ServeHTTP(lw, r)
+
+	elapsed := rl.opts.Now().Sub(msg.When)
+	msg.Seconds = elapsed.Seconds()
+	msg.Code = lw.code
+	switch {
+	case lw.hijacked && msg.Code == 0:
+		msg.Code = http.StatusSwitchingProtocols
+	case msg.Code == 0:
+		msg.Code = http.StatusOK
+	}
+	msg.Bytes = lw.bytes
+	msg.LatencyBucket = rl.latencyBucket(elapsed)
+
+	if msg.Code < 400 {
+		rate := rl.sampleRate(r.URL.Path)
+		if rate <= 0 || (rate < 1 && rl.randFloat64() >= rate) {
+			return
+		}
+	}
+	if rl.opts.Redact != nil {
+		rl.opts.Redact(&msg)
+	}
+	rl.opts.Logf("%s", msg)
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"tailscale.com/tstest"
+)
+
+func TestLogRequests(t *testing.T) {
+	clock := tstest.Clock{
+		Start: time.Now(),
+		Step:  200 * time.Millisecond,
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/missing"):
+			http.NotFound(w, r)
+		case strings.HasSuffix(r.URL.Path, "/empty"):
+		default:
+			w.Write([]byte("hello"))
+		}
+	})
+	opts := RequestLogOptions{
+		SampleRates: map[string]float64{
+			"/assets/":      0,
+			"/assets/keep/": 1,
+		},
+		LatencyBuckets: []time.Duration{100 * time.Millisecond, time.Second},
+		Redact: func(m *AccessLogRecord) {
+			m.RequestURI, _, _ = strings.Cut(m.RequestURI, "?")
+		},
+		Now: clock.Now,
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		wantLog *AccessLogRecord
+	}{
+		{
+			name: "unsampled_route",
+			url:  "http://example.com/api?secret=1",
+			wantLog: &AccessLogRecord{
+				When:          clock.Start,
+				Seconds:       0.2,
+				Proto:         "HTTP/1.1",
+				Host:          "example.com",
+				Method:        "GET",
+				RequestURI:    "/api",
+				RemoteAddr:    "192.0.2.1:1234",
+				Code:          200,
+				Bytes:         5,
+				LatencyBucket: "1s",
+			},
+		},
+		{
+			name: "sampled_out",
+			url:  "http://example.com/assets/app.js",
+		},
+		{
+			name: "sampled_out_error_still_logged",
+			url:  "http://example.com/assets/missing",
+			wantLog: &AccessLogRecord{
+				When:          clock.Start,
+				Seconds:       0.2,
+				Proto:         "HTTP/1.1",
+				Host:          "example.com",
+				Method:        "GET",
+				RequestURI:    "/assets/missing",
+				RemoteAddr:    "192.0.2.1:1234",
+				Code:          404,
+				Bytes:         len("404 page not found\n"),
+				LatencyBucket: "1s",
+			},
+		},
+		{
+			name: "longest_prefix_wins",
+			url:  "http://example.com/assets/keep/empty",
+			wantLog: &AccessLogRecord{
+				When:          clock.Start,
+				Seconds:       0.2,
+				Proto:         "HTTP/1.1",
+				Host:          "example.com",
+				Method:        "GET",
+				RequestURI:    "/assets/keep/empty",
+				RemoteAddr:    "192.0.2.1:1234",
+				Code:          200,
+				LatencyBucket: "1s",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs []AccessLogRecord
+			o := opts
+			o.Logf = func(format string, args ...any) {
+				if format == "%s" {
+					logs = append(logs, args[0].(AccessLogRecord))
+				}
+				t.Logf(format, args...)
+			}
+			clock.Reset()
+
+			req := httptest.NewRequest("GET", tt.url, nil)
+			LogRequests(handler, o).ServeHTTP(httptest.NewRecorder(), req)
+
+			if tt.wantLog == nil {
+				if len(logs) != 0 {
+					t.Errorf("got %d log records; want none", len(logs))
+				}
+				return
+			}
+			if len(logs) != 1 {
+				t.Fatalf("got %d log records; want 1", len(logs))
+			}
+			if diff := cmp.Diff(*tt.wantLog, logs[0]); diff != "" {
+				t.Errorf("wrong log record (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLogRequestsSampleRate(t *testing.T) {
+	for _, tt := range []struct {
+		path    string
+		rand    float64
+		wantLog bool
+	}{
+		{"/half/a", 0.25, true},
+		{"/half/a", 0.5, false},
+		{"/half/a", 0.75, false},
+		{"/other", 0.75, true},
+	} {
+		var logged bool
+		h := LogRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), RequestLogOptions{
+			Logf: func(format string, args ...any) {
+				logged = true
+			},
+			SampleRates: map[string]float64{"/half/": 0.5},
+		})
+		h.(*requestLogger).randFloat64 = func() float64 { return tt.rand }
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+		if logged != tt.wantLog {
+			t.Errorf("%s with rand %v: logged = %v; want %v", tt.path, tt.rand, logged, tt.wantLog)
+		}
+	}
+}
+
+func TestLogRequestsLatencyBucket(t *testing.T) {
+	buckets := []time.Duration{10 * time.Millisecond, 100 * time.Millisecond}
+	for _, tt := range []struct {
+		step time.Duration
+		want string
+	}{
+		{5 * time.Millisecond, "10ms"},
+		{10 * time.Millisecond, "10ms"},
+		{50 * time.Millisecond, "100ms"},
+		{time.Second, "+Inf"},
+	} {
+		clock := tstest.Clock{Start: time.Now(), Step: tt.step}
+		var got string
+		h := LogRequests(http.NotFoundHandler(), RequestLogOptions{
+			Logf: func(format string, args ...any) {
+				got = args[0].(AccessLogRecord).LatencyBucket
+			},
+			LatencyBuckets: buckets,
+			Now:            clock.Now,
+		})
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		if got != tt.want {
+			t.Errorf("latency %v: bucket %q; want %q", tt.step, got, tt.want)
+		}
+	}
+}
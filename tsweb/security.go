@@ -0,0 +1,74 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import "net/http"
+
+// hstsHeader is the Strict-Transport-Security header name. It is only
+// sent on requests that arrived over TLS, as browsers ignore it
+// otherwise.
+const hstsHeader = "Strict-Transport-Security"
+
+// DefaultSecurityHeaders returns the headers SecurityHeaders sets
+// unless overridden. The returned map is a new copy on each call.
+func DefaultSecurityHeaders() map[string]string {
+	return map[string]string{
+		hstsHeader:                   "max-age=63072000; includeSubDomains",
+		"X-Content-Type-Options":     "nosniff",
+		"X-Frame-Options":            "DENY",
+		"Content-Security-Policy":    "frame-ancestors 'none'",
+		"Referrer-Policy":            "same-origin",
+		"Cross-Origin-Opener-Policy": "same-origin",
+		"Permissions-Policy":         "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+	}
+}
+
+// SecurityHeadersOptions configures the handler returned by
+// SecurityHeaders.
+type SecurityHeadersOptions struct {
+	// Overrides replaces the values of DefaultSecurityHeaders, keyed
+	// by header name. An empty value omits that header entirely.
+	// Headers that aren't among the defaults are added.
+	Overrides map[string]string
+
+	// TLSTerminated, if true, sends Strict-Transport-Security even on
+	// plaintext requests, for servers behind a TLS-terminating proxy.
+	TLSTerminated bool
+
+	// Modify, if non-nil, is called on every request after the
+	// headers are set and before the wrapped handler runs, and may
+	// change them, e.g. to relax the Content-Security-Policy for a
+	// particular path.
+	Modify func(h http.Header, r *http.Request)
+}
+
+// SecurityHeaders returns a handler that sets a standard set of
+// security-related response headers (see DefaultSecurityHeaders),
+// adjusted by opts, before calling h. Handlers can still override any
+// of them by setting the header themselves.
+func SecurityHeaders(h http.Handler, opts SecurityHeadersOptions) http.Handler {
+	hdrs := DefaultSecurityHeaders()
+	for k, v := range opts.Overrides {
+		k = http.CanonicalHeaderKey(k)
+		if v == "" {
+			delete(hdrs, k)
+		} else {
+			hdrs[k] = v
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wh := w.Header()
+		for k, v := range hdrs {
+			if k == hstsHeader && r.TLS == nil && !opts.TLSTerminated {
+				continue
+			}
+			wh.Set(k, v)
+		}
+		if opts.Modify != nil {
+			opts.Modify(wh, r)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
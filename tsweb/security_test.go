@@ -0,0 +1,108 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/embed" {
+			w.Header().Del("X-Frame-Options")
+		}
+		w.Write([]byte("ok"))
+	})
+	tests := []struct {
+		name string
+		opts SecurityHeadersOptions
+		path string
+		tls  bool
+		want map[string]string // "" means header must be absent
+	}{
+		{
+			name: "defaults_plaintext",
+			want: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "DENY",
+				"Content-Security-Policy":   "frame-ancestors 'none'",
+				"Referrer-Policy":           "same-origin",
+				"Strict-Transport-Security": "",
+			},
+		},
+		{
+			name: "defaults_tls",
+			tls:  true,
+			want: map[string]string{
+				"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+			},
+		},
+		{
+			name: "tls_terminated",
+			opts: SecurityHeadersOptions{TLSTerminated: true},
+			want: map[string]string{
+				"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+			},
+		},
+		{
+			name: "overrides",
+			opts: SecurityHeadersOptions{Overrides: map[string]string{
+				"referrer-policy":         "no-referrer",
+				"X-Frame-Options":         "",
+				"Content-Security-Policy": "frame-ancestors https://example.com",
+				"X-Custom":                "1",
+			}},
+			want: map[string]string{
+				"Referrer-Policy":         "no-referrer",
+				"X-Frame-Options":         "",
+				"Content-Security-Policy": "frame-ancestors https://example.com",
+				"X-Custom":                "1",
+				"X-Content-Type-Options":  "nosniff",
+			},
+		},
+		{
+			name: "modify",
+			opts: SecurityHeadersOptions{Modify: func(h http.Header, r *http.Request) {
+				h.Set("X-Path", r.URL.Path)
+			}},
+			path: "/foo",
+			want: map[string]string{"X-Path": "/foo"},
+		},
+		{
+			name: "handler_override",
+			path: "/embed",
+			want: map[string]string{"X-Frame-Options": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path
+			if path == "" {
+				path = "/"
+			}
+			req := httptest.NewRequest("GET", path, nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			rec := httptest.NewRecorder()
+			SecurityHeaders(ok, tt.opts).ServeHTTP(rec, req)
+			for k, want := range tt.want {
+				if got := rec.Header().Get(k); got != want {
+					t.Errorf("%s = %q; want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultSecurityHeadersIsCopy(t *testing.T) {
+	DefaultSecurityHeaders()["X-Frame-Options"] = "SAMEORIGIN"
+	if got := DefaultSecurityHeaders()["X-Frame-Options"]; got != "DENY" {
+		t.Errorf("X-Frame-Options default = %q after mutating a copy", got)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"tailscale.com/types/logger"
+)
+
+// Defaults for the ServerConfig timeouts that aren't set.
+const (
+	defaultShutdownTimeout   = 10 * time.Second
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+)
+
+// ServerConfig configures the web server run by Run.
+type ServerConfig struct {
+	// Addr is the TCP address to listen on, as for net.Listen. It is
+	// ignored if Listener is set.
+	Addr string
+
+	// Listener, if non-nil, is used instead of listening on Addr, for
+	// example with a systemd-provided socket or in tests.
+	Listener net.Listener
+
+	// Handler serves requests. If nil, every request gets a 404.
+	Handler http.Handler
+
+	// TLSConfig, if non-nil, makes the server serve HTTPS. It must
+	// provide a certificate, either directly or through
+	// GetCertificate (as autocert.Manager.TLSConfig does).
+	TLSConfig *tls.Config
+
+	// Debug, if non-nil, mounts the tsweb Debugger at /debug/ ahead of
+	// Handler and is called with it, so the caller can add its own
+	// debug pages or replace the access check with SetAuthorizer.
+	Debug func(*DebugHandler)
+
+	// ShutdownTimeout is how long to wait for in-flight requests to
+	// finish once shutdown begins, before closing their connections.
+	// If zero, 10 seconds is used.
+	ShutdownTimeout time.Duration
+
+	// ReadHeaderTimeout is how long a client may take to send a
+	// request's headers, so that slow clients can't hold connections
+	// open indefinitely. If zero, 10 seconds is used.
+	ReadHeaderTimeout time.Duration
+
+	// IdleTimeout is how long idle keep-alive connections are kept
+	// open. If zero, 2 minutes is used.
+	IdleTimeout time.Duration
+
+	// Logf, if non-nil, receives startup and shutdown messages.
+	Logf logger.Logf
+}
+
+// Run serves HTTP (or HTTPS) as configured by cfg until ctx is done or
+// the process receives SIGINT or SIGTERM, then shuts the server down
+// gracefully: it stops accepting connections and waits up to
+// cfg.ShutdownTimeout for active requests to complete.
+//
+// Run returns nil after a clean shutdown, or the error that stopped
+// the server otherwise.
+func Run(ctx context.Context, cfg ServerConfig) error {
+	logf := cfg.Logf
+	if logf == nil {
+		logf = logger.Discard
+	}
+	timeout := cfg.ShutdownTimeout
+	if timeout == 0 {
+		timeout = defaultShutdownTimeout
+	}
+	readHeaderTimeout := cfg.ReadHeaderTimeout
+	if readHeaderTimeout == 0 {
+		readHeaderTimeout = defaultReadHeaderTimeout
+	}
+	idleTimeout := cfg.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = defaultIdleTimeout
+	}
+	h := cfg.Handler
+	if h == nil {
+		h = http.NotFoundHandler()
+	}
+	if cfg.Debug != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/", h)
+		cfg.Debug(Debugger(mux))
+		h = mux
+	}
+
+	ln := cfg.Listener
+	if ln == nil {
+		var err error
+		ln, err = net.Listen("tcp", cfg.Addr)
+		if err != nil {
+			return err
+		}
+	}
+	srv := &http.Server{
+		Handler:           h,
+		TLSConfig:         cfg.TLSConfig,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		if cfg.TLSConfig != nil {
+			errc <- srv.ServeTLS(ln, "", "")
+		} else {
+			errc <- srv.Serve(ln)
+		}
+	}()
+	logf("listening on %v", ln.Addr())
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	logf("shutting down; waiting up to %v for requests to finish", timeout)
+	sctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	shutdownErr := srv.Shutdown(sctx)
+	if shutdownErr != nil {
+		logf("graceful shutdown incomplete: %v; closing remaining connections", shutdownErr)
+		srv.Close()
+	}
+	if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return shutdownErr
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startRun starts Run with cfg on a loopback listener and returns the
+// server's base URL and a channel receiving Run's result.
+func startRun(t *testing.T, ctx context.Context, cfg ServerConfig) (string, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Listener = ln
+	cfg.Logf = t.Logf
+	errc := make(chan error, 1)
+	go func() { errc <- Run(ctx, cfg) }()
+	scheme := "http"
+	if cfg.TLSConfig != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + ln.Addr().String(), errc
+}
+
+func getBody(t *testing.T, c *http.Client, url string) (int, string) {
+	t.Helper()
+	res, err := c.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(b)
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	base, errc := startRun(t, ctx, ServerConfig{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello")
+		}),
+		Debug: func(d *DebugHandler) {
+			d.SetAuthorizer(func(r *http.Request) bool { return r.Header.Get("X-Debug") == "yes" })
+			d.KV("Custom", "value")
+		},
+	})
+
+	if code, body := getBody(t, http.DefaultClient, base+"/"); code != 200 || body != "hello" {
+		t.Errorf("GET / = %d %q; want 200 \"hello\"", code, body)
+	}
+	if code, _ := getBody(t, http.DefaultClient, base+"/debug/"); code != 403 {
+		t.Errorf("GET /debug/ without auth = %d; want 403", code)
+	}
+	req, _ := http.NewRequest("GET", base+"/debug/", nil)
+	req.Header.Set("X-Debug", "yes")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Errorf("GET /debug/ with auth = %d; want 200", res.StatusCode)
+	}
+
+	cancel()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("Run = %v; want nil", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run didn't return after cancel")
+	}
+}
+
+func TestRunGracefulShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan bool)
+	release := make(chan bool)
+	base, errc := startRun(t, ctx, ServerConfig{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			io.WriteString(w, "done")
+		}),
+	})
+
+	type result struct {
+		body string
+		err  error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		res, err := http.Get(base + "/")
+		if err != nil {
+			resc <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		b, err := io.ReadAll(res.Body)
+		resc <- result{string(b), err}
+	}()
+	<-started
+	cancel()
+
+	// Run must wait for the in-flight request.
+	select {
+	case err := <-errc:
+		t.Fatalf("Run returned %v with a request in flight", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if res := <-resc; res.err != nil || res.body != "done" {
+		t.Errorf("in-flight request got %q, %v; want \"done\"", res.body, res.err)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("Run = %v; want nil", err)
+	}
+}
+
+func TestRunShutdownTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan bool)
+	release := make(chan bool)
+	defer close(release)
+	base, errc := startRun(t, ctx, ServerConfig{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}),
+		ShutdownTimeout: 50 * time.Millisecond,
+	})
+
+	go http.Get(base + "/")
+	<-started
+	cancel()
+	select {
+	case err := <-errc:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Run = %v; want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run didn't give up on a stuck request")
+	}
+}
+
+func TestRunReadHeaderTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	base, errc := startRun(t, ctx, ServerConfig{
+		ReadHeaderTimeout: 50 * time.Millisecond,
+	})
+
+	// A client that never finishes its headers is disconnected.
+	c, err := net.Dial("tcp", strings.TrimPrefix(base, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	io.WriteString(c, "GET / HTTP/1.1\r\nHost: x\r\n")
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.ReadAll(c); err != nil {
+		t.Errorf("slow client not disconnected: %v", err)
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("Run = %v; want nil", err)
+	}
+}
+
+func TestRunTLS(t *testing.T) {
+	// Borrow httptest's self-signed certificate and matching client.
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	tlsConfig := ts.TLS.Clone()
+	client := ts.Client()
+	ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	base, errc := startRun(t, ctx, ServerConfig{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil {
+				t.Error("request not over TLS")
+			}
+			io.WriteString(w, "secure")
+		}),
+		TLSConfig: tlsConfig,
+	})
+	if code, body := getBody(t, client, base+"/"); code != 200 || body != "secure" {
+		t.Errorf("GET / = %d %q; want 200 \"secure\"", code, body)
+	}
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("Run = %v; want nil", err)
+	}
+}
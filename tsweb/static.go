@@ -0,0 +1,65 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// immutableCacheControl is sent for content-hashed files, whose
+// contents by definition never change under the same name.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// StaticOptions configures the handler returned by Static.
+type StaticOptions struct {
+	// HashedName matches file names that embed a content hash; such
+	// files are cached as immutable. If nil, DefaultHashedName is
+	// used; see its caveats.
+	HashedName *regexp.Regexp
+
+	// MaxAge is how long browsers may cache files whose names don't
+	// embed a content hash (index.html and the like) before
+	// revalidating. If zero, they must always revalidate, which is
+	// cheap as every response carries an ETag.
+	MaxAge time.Duration
+
+	// Encodings and ModTime are as in PrecompressedOptions.
+	Encodings []string
+	ModTime   time.Time
+}
+
+// Static returns an http.Handler serving the files of fsys, as
+// Precompressed does, with a caching policy suited to bundler output:
+// files with content-hashed names are marked immutable and cacheable
+// for a year, while other files get a short (or zero) max-age. Every
+// response carries a strong ETag and "Vary: Accept-Encoding".
+//
+// fsys should hold only bundler output, or opts.HashedName should be
+// set to a pattern that matches nothing else in it.
+func Static(fsys fs.FS, opts StaticOptions) http.Handler {
+	hashed := opts.HashedName
+	if hashed == nil {
+		hashed = DefaultHashedName
+	}
+	short := "no-cache"
+	if opts.MaxAge > 0 {
+		short = fmt.Sprintf("public, max-age=%d", int64(opts.MaxAge/time.Second))
+	}
+	return Precompressed(fsys, PrecompressedOptions{
+		Encodings: opts.Encodings,
+		ModTime:   opts.ModTime,
+		ETags:     NewETagger(fsys, hashed),
+		CacheControl: func(name string) string {
+			if hashed.MatchString(name) {
+				return immutableCacheControl
+			}
+			return short
+		},
+	})
+}
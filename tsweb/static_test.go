@@ -0,0 +1,117 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStatic(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":          {Data: []byte("<html>")},
+		"main-2KFQ3QAB.js":    {Data: []byte("js")},
+		"main-2KFQ3QAB.js.br": {Data: []byte("br js")},
+		"logo.v42.svg":        {Data: []byte("<svg>")},
+	}
+	tests := []struct {
+		name      string
+		opts      StaticOptions
+		path      string
+		accept    string
+		wantCache string
+		wantETag  string
+		wantBody  string
+	}{
+		{
+			name:      "unhashed_default",
+			path:      "/index.html",
+			wantCache: "no-cache",
+			wantBody:  "<html>",
+		},
+		{
+			name:      "unhashed_max_age",
+			opts:      StaticOptions{MaxAge: 5 * time.Minute},
+			path:      "/index.html",
+			wantCache: "public, max-age=300",
+			wantBody:  "<html>",
+		},
+		{
+			name:      "hashed",
+			path:      "/main-2KFQ3QAB.js",
+			wantCache: "public, max-age=31536000, immutable",
+			wantETag:  `"2KFQ3QAB"`,
+			wantBody:  "js",
+		},
+		{
+			name:      "hashed_precompressed",
+			path:      "/main-2KFQ3QAB.js",
+			accept:    "br",
+			wantCache: "public, max-age=31536000, immutable",
+			wantETag:  `"2KFQ3QAB-br"`,
+			wantBody:  "br js",
+		},
+		{
+			name:      "custom_pattern",
+			opts:      StaticOptions{HashedName: regexp.MustCompile(`\.v(\d+)\.[^./]+$`)},
+			path:      "/logo.v42.svg",
+			wantCache: "public, max-age=31536000, immutable",
+			wantETag:  `"42"`,
+			wantBody:  "<svg>",
+		},
+		{
+			name:      "custom_pattern_excludes_default",
+			opts:      StaticOptions{HashedName: regexp.MustCompile(`\.v(\d+)\.[^./]+$`)},
+			path:      "/main-2KFQ3QAB.js",
+			wantCache: "no-cache",
+			wantBody:  "js",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			Static(fsys, tt.opts).ServeHTTP(rec, req)
+			res := rec.Result()
+			if res.StatusCode != 200 {
+				t.Fatalf("status = %d; want 200", res.StatusCode)
+			}
+			if got := res.Header.Get("Cache-Control"); got != tt.wantCache {
+				t.Errorf("Cache-Control = %q; want %q", got, tt.wantCache)
+			}
+			etag := res.Header.Get("ETag")
+			if tt.wantETag != "" && etag != tt.wantETag {
+				t.Errorf("ETag = %q; want %q", etag, tt.wantETag)
+			} else if etag == "" {
+				t.Error("no ETag")
+			}
+			if got, want := res.Header.Get("Vary"), "Accept-Encoding"; got != want {
+				t.Errorf("Vary = %q; want %q", got, want)
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q; want %q", got, tt.wantBody)
+			}
+
+			// Revalidation with the ETag just received is a 304.
+			req = httptest.NewRequest("GET", tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			req.Header.Set("If-None-Match", etag)
+			rec = httptest.NewRecorder()
+			Static(fsys, tt.opts).ServeHTTP(rec, req)
+			if rec.Code != http.StatusNotModified {
+				t.Errorf("revalidation status = %d; want 304", rec.Code)
+			}
+		})
+	}
+}
@@ -26,7 +26,6 @@
 	"sync"
 	"time"
 
-	"go4.org/mem"
 	"inet.af/netaddr"
 	"tailscale.com/envknob"
 	"tailscale.com/metrics"
@@ -90,29 +89,6 @@ func AllowDebugAccess(r *http.Request) bool {
 	return false
 }
 
-// AcceptsEncoding reports whether r accepts the named encoding
-// ("gzip", "br", etc).
-func AcceptsEncoding(r *http.Request, enc string) bool {
-	h := r.Header.Get("Accept-Encoding")
-	if h == "" {
-		return false
-	}
-	if !strings.Contains(h, enc) && !mem.ContainsFold(mem.S(h), mem.S(enc)) {
-		return false
-	}
-	remain := h
-	for len(remain) > 0 {
-		var part string
-		part, remain, _ = strings.Cut(remain, ",")
-		part = strings.TrimSpace(part)
-		part, _, _ = strings.Cut(part, ";")
-		if part == enc {
-			return true
-		}
-	}
-	return false
-}
-
 // Protected wraps a provided debug handler, h, returning a Handler
 // that enforces AllowDebugAccess and returns forbidden replies for
 // unauthorized requests.
@@ -201,6 +177,10 @@ type HandlerOptions struct {
 	// OnError is called if the handler returned a HTTPError. This
 	// is intended to be used to present pretty error pages if
 	// the user agent is determined to be a browser.
+	//
+	// A generic (non-HTTPError) error is passed to OnError as a 500
+	// HTTPError with Msg "internal server error" and Err set to the
+	// returned error.
 	OnError ErrorHandlerFunc
 }
 
@@ -306,7 +286,11 @@ func (h retHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		msg.Err = err.Error()
 		if lw.code == 0 {
 			msg.Code = http.StatusInternalServerError
-			http.Error(lw, "internal server error", msg.Code)
+			if h.opts.OnError != nil {
+				h.opts.OnError(lw, r, Error(msg.Code, "internal server error", err))
+			} else {
+				http.Error(lw, "internal server error", msg.Code)
+			}
 		}
 	}
 
@@ -617,6 +617,22 @@ func TestAcceptsEncoding(t *testing.T) {
 		{"gzip, foo ", "fo", false},
 		{"gzip;q=1.2, foo ", "gzip", true},
 		{" gzip;q=1.2, foo ", "gzip", true},
+		{"GZIP", "gzip", true},
+		{"gzip", "GZIP", true},
+		{"gzip;q=0", "gzip", false},
+		{"gzip; q=0.0", "gzip", false},
+		{"gzip;q=0.001", "gzip", true},
+		{"gzip;q=bogus", "gzip", false},
+		{"*", "zstd", true},
+		{"*;q=0", "zstd", false},
+		{"gzip, *;q=0", "gzip", true},
+		{"gzip, *;q=0", "br", false},
+		{"br;q=0, *", "br", false},
+		{"", "identity", true},
+		{"gzip", "identity", true},
+		{"identity;q=0", "identity", false},
+		{"*;q=0", "identity", false},
+		{"zstd, br;q=0.9", "zstd", true},
 	}
 	for i, tt := range tests {
 		h := make(http.Header)
@@ -630,6 +646,37 @@ func TestAcceptsEncoding(t *testing.T) {
 	}
 }
 
+func TestPreferredEncodings(t *testing.T) {
+	tests := []struct {
+		in        string
+		supported []string
+		want      []string
+	}{
+		{"", nil, nil},
+		{"gzip", nil, []string{"gzip"}},
+		{"gzip, br", nil, []string{"br", "gzip"}},
+		{"gzip, br, zstd", nil, []string{"zstd", "br", "gzip"}},
+		{"gzip, br;q=0.5, zstd;q=0.1", nil, []string{"gzip", "br", "zstd"}},
+		{"br;q=0, gzip", nil, []string{"gzip"}},
+		{"*", nil, []string{"zstd", "br", "gzip"}},
+		{"*;q=0.5, gzip", nil, []string{"gzip", "zstd", "br"}},
+		{"identity", nil, nil},
+		{"gzip, br", []string{"gzip", "br"}, []string{"gzip", "br"}},
+		{"gzip, br, zstd", []string{"br"}, []string{"br"}},
+		{"deflate", []string{"gzip"}, nil},
+	}
+	for i, tt := range tests {
+		h := make(http.Header)
+		if tt.in != "" {
+			h.Set("Accept-Encoding", tt.in)
+		}
+		got := PreferredEncodings(&http.Request{Header: h}, tt.supported...)
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%d. PreferredEncodings(%q, %q) mismatch (-want +got):\n%s", i, tt.in, tt.supported, diff)
+		}
+	}
+}
+
 func TestPort80Handler(t *testing.T) {
 	tests := []struct {
 		name    string